@@ -7,9 +7,7 @@ import (
 	"os"
 	"strconv"
 
-	"github.com/coreos/bbolt"
 	"github.com/pkg/errors"
-	"github.com/vmihailenco/msgpack"
 )
 
 //Airport represents the fundamental data for an airport.
@@ -24,12 +22,13 @@ type Airport struct {
 	Country   string
 	Continent string
 	Iata      string
+	Locode    string
 }
 
 //loadAirports processes airports.csv and creates an Airport struct
 //representing each one which gets loaded into the Airports bucket in the
 //database.
-func loadAirports(db *bolt.DB, dataDir string) error {
+func loadAirports(store Store, dataDir string) error {
 	apts, err := os.Open(fmt.Sprintf("%s/%s", dataDir, "airports.csv"))
 	if err != nil {
 		return err
@@ -39,13 +38,7 @@ func loadAirports(db *bolt.DB, dataDir string) error {
 	r := csv.NewReader(apts)
 	_, err = r.Read() // skip header
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucketIfNotExists([]byte("Airports"))
-		if err != nil {
-			return err
-		}
-		b := tx.Bucket([]byte("Airports"))
-
+	err = store.Update(func(tx Tx) error {
 		for {
 			record, err := r.Read()
 			if err == io.EOF {
@@ -67,14 +60,15 @@ func loadAirports(db *bolt.DB, dataDir string) error {
 				record[9],
 				record[8],
 				record[7],
-				record[13]}
+				record[13],
+				""}
 
-			m, err := msgpack.Marshal(&apt)
+			m, err := encodeAirport(&apt)
 			if err != nil {
 				return errors.Wrap(err, "airport marshal")
 			}
 
-			err = b.Put([]byte(record[1]), m)
+			err = tx.Put([]byte("Airports"), []byte(record[1]), m)
 			if err != nil {
 				return errors.Wrap(err, "database put")
 			}
@@ -89,17 +83,19 @@ func loadAirports(db *bolt.DB, dataDir string) error {
 
 //GetAirport returns an Airport struct representing the given code
 func (a *AptDB) GetAirport(ident string) (*Airport, error) {
-	var apt Airport
-	err := a.boltDB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Airports"))
-		v := b.Get([]byte(ident))
-		err := msgpack.Unmarshal(v, &apt)
+	var apt *Airport
+	err := a.store.View(func(tx Tx) error {
+		v, err := tx.Get([]byte("Airports"), []byte(ident))
+		if err != nil {
+			return err
+		}
+		apt, err = decodeAirport(v)
 		return err
 	})
 
 	if err != nil {
-		return &apt, errors.Wrap(err, "get airport")
+		return apt, errors.Wrap(err, "get airport")
 	}
 
-	return &apt, nil
+	return apt, nil
 }
@@ -9,22 +9,10 @@ the user.
 */
 package aptdata
 
-import (
-	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"time"
-
-	"github.com/coreos/bbolt"
-	"github.com/pkg/errors"
-	"github.com/vmihailenco/msgpack"
-)
-
-//AptDB provides an opaque wrapper around a boltdb database.  This is returned
-//to the user from OpenDB().
+//AptDB provides an opaque wrapper around a Store.  This is returned to the
+//user from OpenDB() or NewAptDB().
 type AptDB struct {
-	boltDB *bolt.DB
+	store Store
 }
 
 //ErrUnpopulated provides a testable error condition for a database that exists
@@ -40,19 +28,25 @@ func (e ErrUnpopulated) Error() (msg string) {
 
 //Close closes the connection to the airport database.
 func (a *AptDB) Close() error {
-	return a.boltDB.Close()
+	return a.store.Close()
 }
 
 //Populated checks for the presence of an IsPopulated key in the Meta
 //database, and if present confirms that it's true.
 func (a *AptDB) Populated() bool {
 	var isPopulated bool
-	err := a.boltDB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Meta"))
-		if b == nil {
+	err := a.store.View(func(tx Tx) error {
+		if !tx.BucketExists([]byte("Meta")) {
 			return ErrUnpopulated{"meta bucket does not exist"}
 		}
-		msgpack.Unmarshal(b.Get([]byte("IsPopulated")), &isPopulated)
+		v, err := tx.Get([]byte("Meta"), []byte("IsPopulated"))
+		if err != nil {
+			return err
+		}
+		isPopulated, err = decodeBool(v)
+		if err != nil {
+			return err
+		}
 		if isPopulated {
 			return nil
 		}
@@ -69,35 +63,57 @@ func (a *AptDB) Populated() bool {
 //Load will process the downloaded airport and runways files and insert
 //records for each entry in the database.
 func (a *AptDB) Load(dataDir string) error {
-	err := loadAirports(a.boltDB, dataDir)
+	err := loadAirports(a.store, dataDir)
 	if err != nil {
 		return err
 	}
 
-	err = loadRunways(a.boltDB, dataDir)
+	err = loadRunways(a.store, dataDir)
 	if err != nil {
 		return err
 	}
 
-	err = loadCountries(a.boltDB, dataDir)
+	err = loadCountries(a.store, dataDir)
 	if err != nil {
 		return err
 	}
 
-	err = loadRegions(a.boltDB, dataDir)
+	err = loadRegions(a.store, dataDir)
 	if err != nil {
 		return err
 	}
 
-	err = a.boltDB.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucketIfNotExists([]byte("Meta"))
+	err = loadLocodes(a.store, dataDir)
+	if err != nil {
+		return err
+	}
+
+	err = resolveLocodes(a.store)
+	if err != nil {
+		return err
+	}
+
+	err = buildSpatialIndex(a.store)
+	if err != nil {
+		return err
+	}
+
+	err = loadContinents(a.store, dataDir)
+	if err != nil {
+		return err
+	}
+
+	err = buildSecondaryIndexes(a.store)
+	if err != nil {
+		return err
+	}
+
+	err = a.store.Update(func(tx Tx) error {
+		m, err := encodeBool(true)
 		if err != nil {
 			return err
 		}
-		b := tx.Bucket([]byte("Meta"))
-		m, _ := msgpack.Marshal(true)
-		err = b.Put([]byte("IsPopulated"), m)
-		return err
+		return tx.Put([]byte("Meta"), []byte("IsPopulated"), m)
 	})
 
 	return err
@@ -106,35 +122,10 @@ func (a *AptDB) Load(dataDir string) error {
 //Reload deletes existing entries in the database, then loads new records
 //via a call to Load.
 func (a *AptDB) Reload(dataDir string) error {
-	err := a.boltDB.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket([]byte("Airports"))
-		if err != nil {
-			if err.Error() != "bucket not found" {
-				return errors.Wrap(err, "airports bucket")
-			}
-		}
-		err = tx.DeleteBucket([]byte("Runways"))
-		if err != nil {
-			if err.Error() != "bucket not found" {
-				return errors.Wrap(err, "runways bucket")
-			}
-		}
-		err = tx.DeleteBucket([]byte("Countries"))
-		if err != nil {
-			if err.Error() != "bucket not found" {
-				return errors.Wrap(err, "countries bucket")
-			}
-		}
-		err = tx.DeleteBucket([]byte("Regions"))
-		if err != nil {
-			if err.Error() != "bucket not found" {
-				return errors.Wrap(err, "regions bucket")
-			}
-		}
-		err = tx.DeleteBucket([]byte("Meta"))
-		if err != nil {
-			if err.Error() != "bucket not found" {
-				return errors.Wrap(err, "meta bucket")
+	err := a.store.Update(func(tx Tx) error {
+		for _, bucket := range []string{"Airports", "Runways", "Countries", "Regions", "Locodes", "SpatialIndex", "Continents", "AirportsByIATA", "AirportsByCountry", "AirportsByName", "Meta"} {
+			if err := tx.DeleteBucket([]byte(bucket)); err != nil {
+				return err
 			}
 		}
 		return nil
@@ -148,89 +139,20 @@ func (a *AptDB) Reload(dataDir string) error {
 	return err
 }
 
-//downloadDataFile is a utility function for downloading a source file and
-//saving it to the specified data directory.
-func downloadDataFile(dataDir string, filename string, url string, c chan error) {
-	fullPath := fmt.Sprintf("%s/%s", dataDir, filename)
-	out, err := os.Create(fullPath)
-	if err != nil {
-		c <- err
-		return
-	}
-	defer out.Close()
-
-	response, err := http.Get(url)
-	if err != nil {
-		c <- err
-		return
-	}
-	if response.StatusCode != 200 {
-		c <- fmt.Errorf("response code %d for %s", response.StatusCode, url)
-		//c <- DownloadError{message: fmt.Sprintf("response code %d for %s", response.StatusCode, url)}
-		out.Close()
-		os.Remove(fullPath)
-		return
-	}
-	defer response.Body.Close()
-
-	_, err = io.Copy(out, response.Body)
-	if err != nil {
-		c <- err
-		return
-	}
-
-	c <- nil
-}
-
-//OpenDB will open the boltdb and return it wrapped in an AptDB.
+//OpenDB will open the named bbolt file and return it wrapped in an AptDB.
 func OpenDB(path string) (db *AptDB, err error) {
-	var boltDB *bolt.DB
-	//populated := false
-
-	boltDB, err = bolt.Open(path, 0644, nil)
+	store, err := newBoltStore(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return &AptDB{boltDB: boltDB}, err
+	return &AptDB{store: store}, nil
 }
 
-//DownloadData iterates over the named source files and calls downloadDataFile
-//for each one.
-func DownloadData(dataDir string) (err error) {
-	files := [4]string{"airports.csv", "runways.csv", "countries.csv", "regions.csv"}
-	channels := make([]chan error, 4)
-
-	_, err = os.Stat(dataDir)
-	if os.IsNotExist(err) {
-		err = os.Mkdir(dataDir, 0755)
-		if err != nil {
-			return err
-		}
-	} else if err != nil {
-		return err
-	}
-
-	for i, file := range files {
-		c := make(chan error)
-		channels[i] = c
-		go downloadDataFile(dataDir, file, fmt.Sprintf("http://ourairports.com/data/%s", file), c)
-	}
-
-	numDownloaded := 0
-	for numDownloaded < len(files) {
-		for _, c := range channels {
-			select {
-			case err = <-c:
-				if err != nil {
-					return err
-				}
-				numDownloaded++
-				// fmt.Println("DID ONE", files[i]) // logging?
-			default:
-				time.Sleep(100 * time.Millisecond) // prevent spin-polling
-			}
-		}
-	}
-	return nil
+//NewAptDB wraps an arbitrary Store implementation in an AptDB, letting
+//callers plug in backends other than the default bbolt-backed one (e.g. an
+//in-memory store for tests, or a read-only store loaded from an embedded
+//snapshot).
+func NewAptDB(store Store) *AptDB {
+	return &AptDB{store: store}
 }
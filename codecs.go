@@ -0,0 +1,107 @@
+package aptdata
+
+import "github.com/vmihailenco/msgpack"
+
+//Per-record codecs isolate msgpack as an implementation detail of each
+//record type, so a future Store backend could swap encodings without
+//touching load/Get logic.
+
+func encodeAirport(a *Airport) ([]byte, error) {
+	return msgpack.Marshal(a)
+}
+
+func decodeAirport(data []byte) (*Airport, error) {
+	var a Airport
+	err := msgpack.Unmarshal(data, &a)
+	return &a, err
+}
+
+func encodeRunway(r *Runway) ([]byte, error) {
+	return msgpack.Marshal(r)
+}
+
+func decodeRunway(data []byte) (*Runway, error) {
+	var r Runway
+	err := msgpack.Unmarshal(data, &r)
+	return &r, err
+}
+
+func encodeCountry(c *Country) ([]byte, error) {
+	return msgpack.Marshal(c)
+}
+
+func decodeCountry(data []byte) (*Country, error) {
+	var c Country
+	err := msgpack.Unmarshal(data, &c)
+	return &c, err
+}
+
+func encodeRegion(r *Region) ([]byte, error) {
+	return msgpack.Marshal(r)
+}
+
+func decodeRegion(data []byte) (*Region, error) {
+	var r Region
+	err := msgpack.Unmarshal(data, &r)
+	return &r, err
+}
+
+func encodeLocode(l *Locode) ([]byte, error) {
+	return msgpack.Marshal(l)
+}
+
+func decodeLocode(data []byte) (*Locode, error) {
+	var l Locode
+	err := msgpack.Unmarshal(data, &l)
+	return &l, err
+}
+
+func encodeRtreeNode(n *rtreeNode) ([]byte, error) {
+	return msgpack.Marshal(n)
+}
+
+func decodeRtreeNode(data []byte) (*rtreeNode, error) {
+	var n rtreeNode
+	err := msgpack.Unmarshal(data, &n)
+	return &n, err
+}
+
+func encodeContinentIndex(idx *continentIndex) ([]byte, error) {
+	return msgpack.Marshal(idx)
+}
+
+func decodeContinentIndex(data []byte) (*continentIndex, error) {
+	var idx continentIndex
+	err := msgpack.Unmarshal(data, &idx)
+	return &idx, err
+}
+
+func encodeTrigramSet(t *trigramSet) ([]byte, error) {
+	return msgpack.Marshal(t)
+}
+
+func decodeTrigramSet(data []byte) (*trigramSet, error) {
+	var t trigramSet
+	err := msgpack.Unmarshal(data, &t)
+	return &t, err
+}
+
+func encodeDownloadMeta(m *DownloadMeta) ([]byte, error) {
+	return msgpack.Marshal(m)
+}
+
+func decodeDownloadMeta(data []byte) (*DownloadMeta, error) {
+	var m DownloadMeta
+	err := msgpack.Unmarshal(data, &m)
+	return &m, err
+}
+
+func encodeBool(v bool) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func decodeBool(data []byte) (bool, error) {
+	var v bool
+	err := msgpack.Unmarshal(data, &v)
+	return v, err
+}
@@ -0,0 +1,303 @@
+package aptdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+//geoJSONFeatureCollection mirrors the subset of the GeoJSON FeatureCollection
+//spec we need to parse continents.geojson.
+type geoJSONFeatureCollection struct {
+	Features []geoJSONFeature `json:"features"`
+}
+
+//geoJSONFeature is a single polygon or multipolygon feature, carrying the
+//continent code in its properties.
+type geoJSONFeature struct {
+	Properties struct {
+		Continent string `json:"CONTINENT"`
+	} `json:"properties"`
+	Geometry struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+//ring is a closed sequence of (lon, lat) points, as GeoJSON orders them.
+type ring [][2]float64
+
+//continentPolygon is a feature's rings, pre-split at the antimeridian, with
+//a precomputed bounding box for cheap rejection. Outer and Holes are kept
+//separate (rather than flattened into one list) because splitting a ring at
+//the antimeridian can turn it into two fragments, and each fragment must
+//still be tested as the kind of ring (outer boundary or hole) its original
+//ring was.
+type continentPolygon struct {
+	Continent string
+	Outer     []ring
+	Holes     []ring
+	Box       rect
+}
+
+//continentIndex is a bbox-filtered list of continent polygons, built once
+//from continents.geojson and persisted in the Continents bucket.
+type continentIndex struct {
+	Polygons []continentPolygon
+}
+
+//loadContinentIndex parses continents.geojson, precomputes each feature's
+//bounding box, and splits rings that cross the antimeridian so ray-casting
+//doesn't need to special-case the wraparound.
+func loadContinentIndex(dataDir string) (*continentIndex, error) {
+	data, err := os.ReadFile(fmt.Sprintf("%s/%s", dataDir, "continents.geojson"))
+	if err != nil {
+		return nil, err
+	}
+
+	var fc geoJSONFeatureCollection
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, errors.Wrap(err, "continents geojson decode")
+	}
+
+	idx := &continentIndex{}
+
+	for _, feature := range fc.Features {
+		var rawPolygons [][]ring
+
+		switch feature.Geometry.Type {
+		case "Polygon":
+			var rings []ring
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &rings); err != nil {
+				return nil, errors.Wrap(err, "polygon decode")
+			}
+			rawPolygons = [][]ring{rings}
+		case "MultiPolygon":
+			if err := json.Unmarshal(feature.Geometry.Coordinates, &rawPolygons); err != nil {
+				return nil, errors.Wrap(err, "multipolygon decode")
+			}
+		default:
+			continue
+		}
+
+		for _, rings := range rawPolygons {
+			var outer, holes []ring
+			for i, r := range rings {
+				fragments := splitRingAtAntimeridian(r)
+				if i == 0 {
+					outer = append(outer, fragments...)
+				} else {
+					holes = append(holes, fragments...)
+				}
+			}
+
+			idx.Polygons = append(idx.Polygons, continentPolygon{
+				Continent: feature.Properties.Continent,
+				Outer:     outer,
+				Holes:     holes,
+				Box:       ringsBoundingBox(append(append([]ring{}, outer...), holes...)),
+			})
+		}
+	}
+
+	return idx, nil
+}
+
+//splitRingAtAntimeridian returns a ring that does not cross the ±180°
+//meridian unchanged. A ring that does cross it is returned as two whole
+//copies, one with longitudes unwrapped into [0°, 360°) and one shifted by
+//-360°, so that a query point in [-180°, 180°] inside the original ring is
+//inside one of the copies and can be bbox-filtered and ray-cast without
+//wraparound handling.
+func splitRingAtAntimeridian(r ring) []ring {
+	crosses := false
+	for i := 1; i < len(r); i++ {
+		if diff := r[i][0] - r[i-1][0]; diff > 180 || diff < -180 {
+			crosses = true
+			break
+		}
+	}
+
+	if !crosses {
+		return []ring{r}
+	}
+
+	var west, east ring
+	for _, p := range r {
+		lon := p[0]
+		if lon < 0 {
+			lon += 360
+		}
+		west = append(west, [2]float64{lon - 360, p[1]})
+		east = append(east, [2]float64{lon, p[1]})
+	}
+
+	return []ring{west, east}
+}
+
+//ringsBoundingBox returns the bbox covering every point in rings.
+func ringsBoundingBox(rings []ring) rect {
+	box := rect{MinLat: 90, MinLon: 180, MaxLat: -90, MaxLon: -180}
+	for _, r := range rings {
+		for _, p := range r {
+			lon, lat := p[0], p[1]
+			if lat < box.MinLat {
+				box.MinLat = lat
+			}
+			if lat > box.MaxLat {
+				box.MaxLat = lat
+			}
+			if lon < box.MinLon {
+				box.MinLon = lon
+			}
+			if lon > box.MaxLon {
+				box.MaxLon = lon
+			}
+		}
+	}
+	return box
+}
+
+//pointInRing reports whether (lat, lon) is inside r using the standard
+//ray-casting algorithm.
+func pointInRing(lat, lon float64, r ring) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		xi, yi := r[i][0], r[i][1]
+		xj, yj := r[j][0], r[j][1]
+
+		intersects := (yi > lat) != (yj > lat) &&
+			lon < (xj-xi)*(lat-yi)/(yj-yi)+xi
+		if intersects {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+//pointInPolygon reports whether (lat, lon) falls within p, counting a point
+//inside the outer boundary and not inside any hole as a match. By GeoJSON
+//convention the first ring of a polygon is its outer boundary and any
+//remaining rings are holes to subtract; antimeridian splitting can turn
+//either kind into multiple fragments, so a point only needs to fall inside
+//one outer fragment (they don't overlap) and must fall inside none of the
+//hole fragments.
+func pointInPolygon(lat, lon float64, p continentPolygon) bool {
+	if lon < p.Box.MinLon || lon > p.Box.MaxLon || lat < p.Box.MinLat || lat > p.Box.MaxLat {
+		return false
+	}
+
+	inOuter := false
+	for _, r := range p.Outer {
+		if pointInRing(lat, lon, r) {
+			inOuter = true
+			break
+		}
+	}
+	if !inOuter {
+		return false
+	}
+
+	for _, hole := range p.Holes {
+		if pointInRing(lat, lon, hole) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//ContinentAt classifies an arbitrary coordinate against the persisted
+//continent polygon layer, returning its continent code.
+func (a *AptDB) ContinentAt(lat, lon float64) (string, error) {
+	var continent string
+
+	err := a.store.View(func(tx Tx) error {
+		v, err := tx.Get([]byte("Continents"), []byte("index"))
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return errors.New("continent index not built")
+		}
+
+		idx, err := decodeContinentIndex(v)
+		if err != nil {
+			return err
+		}
+
+		continent = classifyContinent(lat, lon, idx)
+		return nil
+	})
+
+	return continent, err
+}
+
+//classifyContinent returns the continent code of the first polygon in idx
+//whose bbox and ring tests both match (lat, lon), or "" if none match.
+func classifyContinent(lat, lon float64, idx *continentIndex) string {
+	for _, p := range idx.Polygons {
+		if pointInPolygon(lat, lon, p) {
+			return p.Continent
+		}
+	}
+	return ""
+}
+
+//loadContinents downloads (via an already-fetched continents.geojson) and
+//indexes the continent polygon layer, persists the index in the Continents
+//bucket, and assigns a continent code to every airport that lacks one so
+//that lookups remain O(1) afterward.
+func loadContinents(store Store, dataDir string) error {
+	idx, err := loadContinentIndex(dataDir)
+	if err != nil {
+		return err
+	}
+
+	return store.Update(func(tx Tx) error {
+		m, err := encodeContinentIndex(idx)
+		if err != nil {
+			return errors.Wrap(err, "continent index marshal")
+		}
+		if err := tx.Put([]byte("Continents"), []byte("index"), m); err != nil {
+			return errors.Wrap(err, "database put")
+		}
+
+		var idents [][]byte
+		err = tx.ForEachInBucket([]byte("Airports"), func(k, v []byte) error {
+			idents = append(idents, append([]byte{}, k...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, ident := range idents {
+			v, err := tx.Get([]byte("Airports"), ident)
+			if err != nil {
+				return err
+			}
+			apt, err := decodeAirport(v)
+			if err != nil {
+				return errors.Wrap(err, "airport unmarshal")
+			}
+
+			if apt.Continent != "" {
+				continue
+			}
+			apt.Continent = classifyContinent(apt.Latitude, apt.Longitude, idx)
+
+			m, err := encodeAirport(apt)
+			if err != nil {
+				return errors.Wrap(err, "airport marshal")
+			}
+			if err := tx.Put([]byte("Airports"), ident, m); err != nil {
+				return errors.Wrap(err, "database put")
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,44 @@
+package aptdata
+
+import "testing"
+
+//TestPointInPolygonAntimeridianOuterRing builds a continentPolygon whose
+//outer boundary itself crosses the antimeridian (as Russia's or Fiji's does
+//in real continent data) plus a hole that doesn't, and checks that points on
+//either side of the split outer ring are still classified as inside, while
+//a point inside the hole or entirely outside the band is not. This guards
+//against flattening outer and hole fragments into one list, which would
+//have a dateline-crossing outer half wrongly subtracted as a hole.
+func TestPointInPolygonAntimeridianOuterRing(t *testing.T) {
+	outer := ring{{170, -10}, {-170, -10}, {-170, 10}, {170, 10}, {170, -10}}
+	hole := ring{{178, -2}, {176, -2}, {176, 2}, {178, 2}, {178, -2}}
+
+	outerFragments := splitRingAtAntimeridian(outer)
+	if len(outerFragments) != 2 {
+		t.Fatalf("splitRingAtAntimeridian(outer) returned %d fragments, want 2", len(outerFragments))
+	}
+	holeFragments := splitRingAtAntimeridian(hole)
+	if len(holeFragments) != 1 {
+		t.Fatalf("splitRingAtAntimeridian(hole) returned %d fragments, want 1", len(holeFragments))
+	}
+
+	p := continentPolygon{
+		Continent: "AS",
+		Outer:     outerFragments,
+		Holes:     holeFragments,
+		Box:       ringsBoundingBox(append(append([]ring{}, outerFragments...), holeFragments...)),
+	}
+
+	if !pointInPolygon(0, 179, p) {
+		t.Error("point at (0, 179), east of the split, should be inside the outer ring")
+	}
+	if !pointInPolygon(0, -179, p) {
+		t.Error("point at (0, -179), west of the split, should be inside the outer ring")
+	}
+	if pointInPolygon(0, 177, p) {
+		t.Error("point at (0, 177) falls inside the hole and should be excluded")
+	}
+	if pointInPolygon(0, 0, p) {
+		t.Error("point at (0, 0) is outside the polygon band and should not match")
+	}
+}
@@ -6,9 +6,7 @@ import (
 	"io"
 	"os"
 
-	"github.com/coreos/bbolt"
 	"github.com/pkg/errors"
-	"github.com/vmihailenco/msgpack"
 )
 
 //Country maps country codes to names
@@ -19,7 +17,7 @@ type Country struct {
 
 //loadCountries processes countries.csv and loads a Country struct into
 //the Countries bucket in the DB for every record
-func loadCountries(db *bolt.DB, dataDir string) error {
+func loadCountries(store Store, dataDir string) error {
 	countries, err := os.Open(fmt.Sprintf("%s/%s", dataDir, "countries.csv"))
 	if err != nil {
 		return err
@@ -29,13 +27,7 @@ func loadCountries(db *bolt.DB, dataDir string) error {
 	r := csv.NewReader(countries)
 	_, err = r.Read() // skip header
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucketIfNotExists([]byte("Countries"))
-		if err != nil {
-			return err
-		}
-		b := tx.Bucket([]byte("Countries"))
-
+	err = store.Update(func(tx Tx) error {
 		for {
 			record, err := r.Read()
 			if err == io.EOF {
@@ -47,12 +39,12 @@ func loadCountries(db *bolt.DB, dataDir string) error {
 
 			country := Country{record[1], record[2]}
 
-			m, err := msgpack.Marshal(&country)
+			m, err := encodeCountry(&country)
 			if err != nil {
 				return errors.Wrap(err, "country marshal")
 			}
 
-			err = b.Put([]byte(record[1]), m)
+			err = tx.Put([]byte("Countries"), []byte(record[1]), m)
 			if err != nil {
 				return errors.Wrap(err, "database put")
 			}
@@ -67,17 +59,19 @@ func loadCountries(db *bolt.DB, dataDir string) error {
 
 //GetCountry returns a Country struct representing the given code
 func (a *AptDB) GetCountry(ident string) (*Country, error) {
-	var country Country
-	err := a.boltDB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Countries"))
-		v := b.Get([]byte(ident))
-		err := msgpack.Unmarshal(v, &country)
+	var country *Country
+	err := a.store.View(func(tx Tx) error {
+		v, err := tx.Get([]byte("Countries"), []byte(ident))
+		if err != nil {
+			return err
+		}
+		country, err = decodeCountry(v)
 		return err
 	})
 
 	if err != nil {
-		return &country, errors.Wrap(err, "get country")
+		return country, errors.Wrap(err, "get country")
 	}
 
-	return &country, nil
+	return country, nil
 }
@@ -0,0 +1,249 @@
+package aptdata
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//trigramSet is the codec payload for a single trigram's postings list.
+type trigramSet struct {
+	Codes []string
+}
+
+//indexReady reports whether the named secondary index has finished a full
+//build, gating reads on a per-index sub-flag under Meta so a partial
+//upgrade (e.g. one that crashed mid-rebuild) doesn't serve stale results.
+func indexReady(tx Tx, name string) bool {
+	v, err := tx.Get([]byte("Meta"), []byte("Index"+name+"Populated"))
+	if err != nil || v == nil {
+		return false
+	}
+	ready, err := decodeBool(v)
+	return err == nil && ready
+}
+
+//markIndexReady flips the per-index sub-flag for name under Meta.
+func markIndexReady(tx Tx, name string) error {
+	m, err := encodeBool(true)
+	if err != nil {
+		return err
+	}
+	return tx.Put([]byte("Meta"), []byte("Index"+name+"Populated"), m)
+}
+
+//buildSecondaryIndexes walks the Airports bucket once and builds the
+//AirportsByIATA, AirportsByCountry, and AirportsByName indexes, marking
+//each ready under Meta only once its build has fully completed.
+func buildSecondaryIndexes(store Store) error {
+	return store.Update(func(tx Tx) error {
+		trigrams := make(map[string][]string)
+
+		err := tx.ForEachInBucket([]byte("Airports"), func(k, v []byte) error {
+			apt, err := decodeAirport(v)
+			if err != nil {
+				return errors.Wrap(err, "airport unmarshal")
+			}
+
+			if apt.Iata != "" {
+				if err := tx.Put([]byte("AirportsByIATA"), []byte(apt.Iata), []byte(apt.Code)); err != nil {
+					return errors.Wrap(err, "iata index put")
+				}
+			}
+
+			if apt.Country != "" {
+				bucket := []byte("AirportsByCountry/" + apt.Country)
+				if err := tx.CreateNestedBucket(bucket); err != nil {
+					return errors.Wrap(err, "country index bucket")
+				}
+				if err := tx.Put(bucket, []byte(apt.Code), []byte(apt.Code)); err != nil {
+					return errors.Wrap(err, "country index put")
+				}
+			}
+
+			seen := make(map[string]struct{})
+			for _, t := range nameTrigrams(apt.Name) {
+				if _, ok := seen[t]; ok {
+					continue
+				}
+				seen[t] = struct{}{}
+				trigrams[t] = append(trigrams[t], apt.Code)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for t, codes := range trigrams {
+			m, err := encodeTrigramSet(&trigramSet{Codes: codes})
+			if err != nil {
+				return errors.Wrap(err, "trigram marshal")
+			}
+			if err := tx.Put([]byte("AirportsByName"), []byte(t), m); err != nil {
+				return errors.Wrap(err, "name index put")
+			}
+		}
+
+		if err := markIndexReady(tx, "IATA"); err != nil {
+			return err
+		}
+		if err := markIndexReady(tx, "Country"); err != nil {
+			return err
+		}
+		return markIndexReady(tx, "Name")
+	})
+}
+
+//nameTrigrams returns the case-folded, overlapping 3-character substrings
+//of name, used as postings keys for fuzzy name search.
+func nameTrigrams(name string) []string {
+	folded := strings.ToLower(name)
+	runes := []rune(folded)
+	if len(runes) < 3 {
+		return nil
+	}
+
+	var trigrams []string
+	for i := 0; i <= len(runes)-3; i++ {
+		trigrams = append(trigrams, string(runes[i:i+3]))
+	}
+	return trigrams
+}
+
+//GetAirportByIATA returns the Airport with the given IATA code.
+func (a *AptDB) GetAirportByIATA(iata string) (*Airport, error) {
+	var apt *Airport
+	err := a.store.View(func(tx Tx) error {
+		if !indexReady(tx, "IATA") {
+			return ErrUnpopulated{"iata index not populated"}
+		}
+
+		icao, err := tx.Get([]byte("AirportsByIATA"), []byte(iata))
+		if err != nil {
+			return err
+		}
+		if icao == nil {
+			return errors.Errorf("no airport with IATA code %q", iata)
+		}
+
+		v, err := tx.Get([]byte("Airports"), icao)
+		if err != nil {
+			return err
+		}
+		apt, err = decodeAirport(v)
+		return err
+	})
+
+	if err != nil {
+		return apt, errors.Wrap(err, "get airport by iata")
+	}
+
+	return apt, nil
+}
+
+//AirportsInCountry returns every airport whose country code matches cc.
+func (a *AptDB) AirportsInCountry(cc string) ([]*Airport, error) {
+	var airports []*Airport
+	err := a.store.View(func(tx Tx) error {
+		if !indexReady(tx, "Country") {
+			return ErrUnpopulated{"country index not populated"}
+		}
+
+		return tx.ForEachInBucket([]byte("AirportsByCountry/"+cc), func(k, v []byte) error {
+			av, err := tx.Get([]byte("Airports"), v)
+			if err != nil {
+				return err
+			}
+			apt, err := decodeAirport(av)
+			if err != nil {
+				return err
+			}
+			airports = append(airports, apt)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return airports, errors.Wrap(err, "airports in country")
+	}
+
+	return airports, nil
+}
+
+//nameMatch pairs an airport code with its shared-trigram score against a
+//query, used to rank SearchAirportsByName results.
+type nameMatch struct {
+	code  string
+	score int
+}
+
+//SearchAirportsByName returns up to limit airports whose name shares the
+//most trigrams with query, ranked by shared-trigram count.
+func (a *AptDB) SearchAirportsByName(query string, limit int) ([]*Airport, error) {
+	var airports []*Airport
+
+	err := a.store.View(func(tx Tx) error {
+		if !indexReady(tx, "Name") {
+			return ErrUnpopulated{"name index not populated"}
+		}
+
+		scores := make(map[string]int)
+		for _, t := range nameTrigrams(query) {
+			v, err := tx.Get([]byte("AirportsByName"), []byte(t))
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				continue
+			}
+			set, err := decodeTrigramSet(v)
+			if err != nil {
+				return err
+			}
+			for _, code := range set.Codes {
+				scores[code]++
+			}
+		}
+
+		matches := make([]nameMatch, 0, len(scores))
+		for code, score := range scores {
+			matches = append(matches, nameMatch{code, score})
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			if matches[i].score != matches[j].score {
+				return matches[i].score > matches[j].score
+			}
+			return matches[i].code < matches[j].code
+		})
+
+		if limit > 0 && len(matches) > limit {
+			matches = matches[:limit]
+		}
+
+		for _, m := range matches {
+			v, err := tx.Get([]byte("Airports"), []byte(m.code))
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				continue
+			}
+			apt, err := decodeAirport(v)
+			if err != nil {
+				return err
+			}
+			airports = append(airports, apt)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return airports, errors.Wrap(err, "search airports by name")
+	}
+
+	return airports, nil
+}
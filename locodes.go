@@ -0,0 +1,292 @@
+package aptdata
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Locode represents a UN/LOCODE entry, cross-referencing a location with its
+//country, subdivision, function classifier, and coordinates.
+type Locode struct {
+	Country         string
+	Code            string
+	Name            string
+	SubdivisionCode string
+	SubdivisionName string
+	Function        string
+	Latitude        float64
+	Longitude       float64
+}
+
+//coordPattern matches a UN/LOCODE degrees-and-minutes coordinate pair, e.g.
+//"4234N 07406W".
+var coordPattern = regexp.MustCompile(`^(\d{2})(\d{2})([NS]) (\d{3})(\d{2})([EW])$`)
+
+//parseLocodeCoordinates converts a UN/LOCODE coordinate string such as
+//"4234N 07406W" into decimal-degrees latitude and longitude.
+func parseLocodeCoordinates(coord string) (latitude, longitude float64, err error) {
+	m := coordPattern.FindStringSubmatch(coord)
+	if m == nil {
+		return 0, 0, fmt.Errorf("unrecognized coordinate format: %q", coord)
+	}
+
+	latDeg, _ := strconv.ParseFloat(m[1], 64)
+	latMin, _ := strconv.ParseFloat(m[2], 64)
+	latitude = latDeg + latMin/60
+	if m[3] == "S" {
+		latitude = -latitude
+	}
+
+	lonDeg, _ := strconv.ParseFloat(m[4], 64)
+	lonMin, _ := strconv.ParseFloat(m[5], 64)
+	longitude = lonDeg + lonMin/60
+	if m[6] == "W" {
+		longitude = -longitude
+	}
+
+	return latitude, longitude, nil
+}
+
+//loadLocodes processes the UN/LOCODE CodeList and SubdivisionCodes CSVs and
+//loads a Locode struct into the Locodes bucket in the DB for every entry,
+//keyed by the concatenation of country code and location code.
+func loadLocodes(store Store, dataDir string) error {
+	subdivisions, err := loadLocodeSubdivisions(dataDir)
+	if err != nil {
+		return err
+	}
+
+	codes, err := os.Open(fmt.Sprintf("%s/%s", dataDir, "CodeList.csv"))
+	if err != nil {
+		return err
+	}
+	defer codes.Close()
+
+	r := csv.NewReader(codes)
+	r.FieldsPerRecord = -1
+	_, err = r.Read() // skip header
+
+	err = store.Update(func(tx Tx) error {
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return errors.Wrap(err, "locode read")
+			}
+
+			country := record[1]
+			loc := record[2]
+			if country == "" || loc == "" {
+				continue
+			}
+
+			var latitude, longitude float64
+			if record[10] != "" {
+				latitude, longitude, _ = parseLocodeCoordinates(record[10])
+			}
+
+			// CodeList.csv columns: Ch, Country, Location, Name,
+			// NameWoDiacritics, SubDiv, Function, Status, Date, IATA,
+			// Coordinates, Remarks.
+			subdivCode := record[5]
+			subdiv := subdivisions[country+subdivCode]
+
+			lc := Locode{country,
+				loc,
+				record[3],
+				subdivCode,
+				subdiv,
+				record[6],
+				latitude,
+				longitude}
+
+			m, err := encodeLocode(&lc)
+			if err != nil {
+				return errors.Wrap(err, "locode marshal")
+			}
+
+			err = tx.Put([]byte("Locodes"), []byte(country+loc), m)
+			if err != nil {
+				return errors.Wrap(err, "database put")
+			}
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+//loadLocodeSubdivisions reads SubdivisionCodes.csv into a map keyed by
+//country code plus subdivision code, yielding the subdivision name.
+func loadLocodeSubdivisions(dataDir string) (map[string]string, error) {
+	subdivisions := make(map[string]string)
+
+	f, err := os.Open(fmt.Sprintf("%s/%s", dataDir, "SubdivisionCodes.csv"))
+	if err != nil {
+		return subdivisions, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	_, err = r.Read() // skip header
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return subdivisions, errors.Wrap(err, "subdivision read")
+		}
+
+		subdivisions[record[0]+record[1]] = record[2]
+	}
+
+	return subdivisions, nil
+}
+
+//GetLocode returns a Locode struct representing the given country code and
+//location code.
+func (a *AptDB) GetLocode(cc, loc string) (*Locode, error) {
+	var lc *Locode
+	err := a.store.View(func(tx Tx) error {
+		v, err := tx.Get([]byte("Locodes"), []byte(cc+loc))
+		if err != nil {
+			return err
+		}
+		lc, err = decodeLocode(v)
+		return err
+	})
+
+	if err != nil {
+		return lc, errors.Wrap(err, "get locode")
+	}
+
+	return lc, nil
+}
+
+//FindLocodesByCountry returns every Locode entry for the given country code.
+func (a *AptDB) FindLocodesByCountry(cc string) ([]*Locode, error) {
+	var locodes []*Locode
+	err := a.store.View(func(tx Tx) error {
+		return tx.ForEachInBucket([]byte("Locodes"), func(k, v []byte) error {
+			if !strings.HasPrefix(string(k), cc) {
+				return nil
+			}
+			lc, err := decodeLocode(v)
+			if err != nil {
+				return err
+			}
+			locodes = append(locodes, lc)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return locodes, errors.Wrap(err, "find locodes by country")
+	}
+
+	return locodes, nil
+}
+
+//resolveLocodes walks the Airports bucket and joins each airport to a
+//UN/LOCODE entry via matchLocode, persisting the resolved LOCODE back onto
+//the Airport record.
+func resolveLocodes(store Store) error {
+	return store.Update(func(tx Tx) error {
+		if !tx.BucketExists([]byte("Airports")) {
+			return nil
+		}
+
+		byName, err := locodesByCountryName(tx)
+		if err != nil {
+			return err
+		}
+
+		var idents [][]byte
+		err = tx.ForEachInBucket([]byte("Airports"), func(k, v []byte) error {
+			idents = append(idents, append([]byte{}, k...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, ident := range idents {
+			v, err := tx.Get([]byte("Airports"), ident)
+			if err != nil {
+				return err
+			}
+			apt, err := decodeAirport(v)
+			if err != nil {
+				return errors.Wrap(err, "airport unmarshal")
+			}
+
+			apt.Locode = matchLocode(tx, apt, byName)
+
+			m, err := encodeAirport(apt)
+			if err != nil {
+				return errors.Wrap(err, "airport marshal")
+			}
+
+			if err := tx.Put([]byte("Airports"), ident, m); err != nil {
+				return errors.Wrap(err, "database put")
+			}
+		}
+
+		return nil
+	})
+}
+
+//locodesByCountryName builds a country+lowercased-name -> LOCODE index over
+//the whole Locodes bucket in a single pass, so matchLocode can resolve an
+//airport's city by name without rescanning the bucket for every airport.
+//Where more than one LOCODE shares a country+name, the first one
+//encountered wins.
+func locodesByCountryName(tx Tx) (map[string]string, error) {
+	byName := make(map[string]string)
+	if !tx.BucketExists([]byte("Locodes")) {
+		return byName, nil
+	}
+
+	err := tx.ForEachInBucket([]byte("Locodes"), func(k, v []byte) error {
+		lc, err := decodeLocode(v)
+		if err != nil {
+			return err
+		}
+		key := lc.Country + strings.ToLower(lc.Name)
+		if _, exists := byName[key]; !exists {
+			byName[key] = lc.Code
+		}
+		return nil
+	})
+
+	return byName, err
+}
+
+//matchLocode resolves the UN/LOCODE entry for an airport by joining on
+//country code plus either a matching IATA/LOCODE or a matching city/location
+//name (via byName, a country+lowercased-name index built once per
+//resolveLocodes call), and returns the resolved LOCODE (or an empty string
+//if none matched).
+func matchLocode(tx Tx, apt *Airport, byName map[string]string) string {
+	if apt.Iata != "" {
+		v, _ := tx.Get([]byte("Locodes"), []byte(apt.Country+apt.Iata))
+		if v != nil {
+			return apt.Iata
+		}
+	}
+
+	return byName[apt.Country+strings.ToLower(apt.City)]
+}
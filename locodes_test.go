@@ -0,0 +1,64 @@
+package aptdata
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLocodeCoordinates(t *testing.T) {
+	lat, lon, err := parseLocodeCoordinates("4042N 07400W")
+	if err != nil {
+		t.Fatalf("parseLocodeCoordinates: %v", err)
+	}
+
+	wantLat := 40 + 42.0/60
+	wantLon := -(74 + 0.0/60)
+
+	if math.Abs(lat-wantLat) > 1e-6 {
+		t.Errorf("latitude = %v, want %v", lat, wantLat)
+	}
+	if math.Abs(lon-wantLon) > 1e-6 {
+		t.Errorf("longitude = %v, want %v", lon, wantLon)
+	}
+}
+
+func TestLoadLocodes(t *testing.T) {
+	dir := t.TempDir()
+
+	codeList := "Ch,Country,Location,Name,NameWoDiacritics,SubDiv,Function,Status,Date,IATA,Coordinates,Remarks\n" +
+		",US,NYC,New York,New York,NY,1,AI,0101,NYC,4042N 07400W,\n"
+	if err := os.WriteFile(filepath.Join(dir, "CodeList.csv"), []byte(codeList), 0644); err != nil {
+		t.Fatalf("write CodeList.csv: %v", err)
+	}
+
+	subdivisionCodes := "Country,Subdivision,Name\nUS,NY,New York\n"
+	if err := os.WriteFile(filepath.Join(dir, "SubdivisionCodes.csv"), []byte(subdivisionCodes), 0644); err != nil {
+		t.Fatalf("write SubdivisionCodes.csv: %v", err)
+	}
+
+	store := NewMemStore()
+	if err := loadLocodes(store, dir); err != nil {
+		t.Fatalf("loadLocodes: %v", err)
+	}
+
+	a := NewAptDB(store)
+	lc, err := a.GetLocode("US", "NYC")
+	if err != nil {
+		t.Fatalf("GetLocode: %v", err)
+	}
+
+	if lc.Name != "New York" {
+		t.Errorf("Name = %q, want %q", lc.Name, "New York")
+	}
+	if lc.SubdivisionCode != "NY" {
+		t.Errorf("SubdivisionCode = %q, want %q", lc.SubdivisionCode, "NY")
+	}
+	if lc.SubdivisionName != "New York" {
+		t.Errorf("SubdivisionName = %q, want %q", lc.SubdivisionName, "New York")
+	}
+	if lc.Function != "1" {
+		t.Errorf("Function = %q, want %q", lc.Function, "1")
+	}
+}
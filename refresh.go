@@ -0,0 +1,363 @@
+package aptdata
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//DownloadMeta records what we know about the last successful fetch of a
+//source file, so a later refresh can send conditional request headers and
+//recognize when the on-disk content hasn't actually changed.
+type DownloadMeta struct {
+	ETag         string
+	LastModified string
+	SHA256       string
+}
+
+//RefreshOptions tunes a call to DownloadData or Refresh.
+type RefreshOptions struct {
+	//Force re-downloads and reloads every source file, ignoring any
+	//conditional headers or recorded checksums.
+	Force bool
+	//Timeout bounds the download phase; the load steps that Refresh runs
+	//afterwards are not bounded by it. Zero means no timeout.
+	Timeout time.Duration
+	//Parallelism caps how many files download concurrently; zero means
+	//one goroutine per file.
+	Parallelism int
+	//Progress, if non-nil, is called as each file's body is streamed to
+	//disk. total is -1 if the server didn't send a Content-Length.
+	Progress func(file string, bytes, total int64)
+}
+
+//downloadFileSpec pairs a source filename with its upstream URL.
+type downloadFileSpec struct {
+	file string
+	url  string
+}
+
+//dataFiles is the canonical set of source files Load expects to find in a
+//data directory.
+var dataFiles = []downloadFileSpec{
+	{"airports.csv", "http://ourairports.com/data/airports.csv"},
+	{"runways.csv", "http://ourairports.com/data/runways.csv"},
+	{"countries.csv", "http://ourairports.com/data/countries.csv"},
+	{"regions.csv", "http://ourairports.com/data/regions.csv"},
+	{"CodeList.csv", "https://datahub.io/core/un-locode/r/code-list.csv"},
+	{"SubdivisionCodes.csv", "https://datahub.io/core/un-locode/r/subdivision-codes.csv"},
+	{"continents.geojson", "https://raw.githubusercontent.com/datasets/geo-countries/master/data/continents.geojson"},
+}
+
+//downloadFileResult is what a single file download produces: either the
+//file was unchanged (NotModified, or its checksum matched what we already
+//had recorded) or it was fetched fresh with new DownloadMeta.
+type downloadFileResult struct {
+	file        string
+	meta        DownloadMeta
+	notModified bool
+	err         error
+}
+
+//DownloadData fetches every source file into dataDir, sending
+//If-None-Match/If-Modified-Since based on previously recorded metadata and
+//skipping files the server reports as unchanged. It records each file's
+//new DownloadMeta in the Downloads bucket and returns the set of files
+//whose content changed (a file served again with an identical checksum is
+//rewritten on disk but not included).
+func (a *AptDB) DownloadData(ctx context.Context, dataDir string, opts RefreshOptions) (map[string]bool, error) {
+	return a.downloadAndRecord(ctx, dataDir, opts)
+}
+
+//downloadDataFile fetches spec into dataDir, sending conditional headers
+//built from prev when not forcing a full refresh. It returns the file's
+//new DownloadMeta (SHA-256 included) and whether the server/on-disk
+//checksum indicate the content is unchanged from prev.
+func downloadDataFile(ctx context.Context, dataDir string, spec downloadFileSpec, prev DownloadMeta, opts RefreshOptions) (DownloadMeta, bool, error) {
+	fullPath := fmt.Sprintf("%s/%s", dataDir, spec.file)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, spec.url, nil)
+	if err != nil {
+		return DownloadMeta{}, false, err
+	}
+
+	if !opts.Force {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return DownloadMeta{}, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return prev, true, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return DownloadMeta{}, false, fmt.Errorf("response code %d for %s", resp.StatusCode, spec.url)
+	}
+
+	out, err := os.Create(fullPath)
+	if err != nil {
+		return DownloadMeta{}, false, err
+	}
+	defer out.Close()
+
+	hasher := sha256.New()
+	var written int64
+	total := resp.ContentLength
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := out.Write(buf[:n]); err != nil {
+				return DownloadMeta{}, false, err
+			}
+			hasher.Write(buf[:n])
+			written += int64(n)
+			if opts.Progress != nil {
+				opts.Progress(spec.file, written, total)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return DownloadMeta{}, false, readErr
+		}
+	}
+
+	meta := DownloadMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		SHA256:       hex.EncodeToString(hasher.Sum(nil)),
+	}
+
+	if !opts.Force && meta.SHA256 == prev.SHA256 && prev.SHA256 != "" {
+		return meta, true, nil
+	}
+
+	return meta, false, nil
+}
+
+//Refresh downloads every source file (skipping any the server or checksum
+//say are unchanged, unless opts.Force is set), records the new
+//per-file DownloadMeta, and then re-runs the load steps for the files that
+//changed plus the cross-table rebuilds (see loadChanged). With opts.Force,
+//or when the database is not yet populated, it reloads everything. If
+//nothing changed, Refresh is a near-instant no-op.
+func (a *AptDB) Refresh(ctx context.Context, dataDir string, opts RefreshOptions) error {
+	changed, err := a.downloadAndRecord(ctx, dataDir, opts)
+	if err != nil {
+		return err
+	}
+
+	if !opts.Force && len(changed) == 0 && a.Populated() {
+		return nil
+	}
+
+	if opts.Force || !a.Populated() {
+		return a.Reload(dataDir)
+	}
+
+	return a.loadChanged(dataDir, changed)
+}
+
+//downloadAndRecord performs the downloads and persists each file's
+//DownloadMeta in the Downloads bucket, returning the set of files whose
+//content actually changed.
+func (a *AptDB) downloadAndRecord(ctx context.Context, dataDir string, opts RefreshOptions) (map[string]bool, error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	_, err := os.Stat(dataDir)
+	if os.IsNotExist(err) {
+		if err := os.Mkdir(dataDir, 0755); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	prevMeta := make(map[string]DownloadMeta)
+	err = a.store.View(func(tx Tx) error {
+		for _, spec := range dataFiles {
+			v, err := tx.Get([]byte("Downloads"), []byte(spec.file))
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				continue
+			}
+			meta, err := decodeDownloadMeta(v)
+			if err != nil {
+				return err
+			}
+			prevMeta[spec.file] = *meta
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = len(dataFiles)
+	}
+
+	sem := make(chan struct{}, parallelism)
+	results := make(chan downloadFileResult, len(dataFiles))
+	var wg sync.WaitGroup
+
+	for _, spec := range dataFiles {
+		spec := spec
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			meta, notModified, err := downloadDataFile(ctx, dataDir, spec, prevMeta[spec.file], opts)
+			results <- downloadFileResult{file: spec.file, meta: meta, notModified: notModified, err: err}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	changed := make(map[string]bool)
+	var firstErr error
+	for res := range results {
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrapf(res.err, "download %s", res.file)
+			}
+			continue
+		}
+		if !res.notModified {
+			changed[res.file] = true
+		}
+
+		if err := a.store.Update(func(tx Tx) error {
+			m, err := encodeDownloadMeta(&res.meta)
+			if err != nil {
+				return err
+			}
+			return tx.Put([]byte("Downloads"), []byte(res.file), m)
+		}); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return changed, firstErr
+}
+
+//clearBucket deletes bucket in its own transaction. loadChanged uses this
+//to empty a bucket before re-running its loader, since the load* functions
+//only Put records read from the source file and would otherwise leave
+//behind any record that disappeared from a changed upstream CSV.
+func (a *AptDB) clearBucket(bucket string) error {
+	return a.store.Update(func(tx Tx) error {
+		return tx.DeleteBucket([]byte(bucket))
+	})
+}
+
+//loadChanged re-runs only the load* steps whose source file is present in
+//changed, clearing each step's bucket first so a record dropped from the
+//upstream CSV is actually removed rather than merely left stale, then
+//always re-runs the cross-cutting steps that join across tables (UN/LOCODE
+//matching, the spatial index, continent resolution, and the secondary
+//indexes) since any of them could be affected by a changed file. Those
+//cross-cutting steps each do a full rebuild from the current Airports/
+//Locodes data, so their buckets are cleared first too.
+func (a *AptDB) loadChanged(dataDir string, changed map[string]bool) error {
+	if changed["airports.csv"] {
+		if err := a.clearBucket("Airports"); err != nil {
+			return err
+		}
+		if err := loadAirports(a.store, dataDir); err != nil {
+			return err
+		}
+	}
+	if changed["runways.csv"] {
+		if err := a.clearBucket("Runways"); err != nil {
+			return err
+		}
+		if err := loadRunways(a.store, dataDir); err != nil {
+			return err
+		}
+	}
+	if changed["countries.csv"] {
+		if err := a.clearBucket("Countries"); err != nil {
+			return err
+		}
+		if err := loadCountries(a.store, dataDir); err != nil {
+			return err
+		}
+	}
+	if changed["regions.csv"] {
+		if err := a.clearBucket("Regions"); err != nil {
+			return err
+		}
+		if err := loadRegions(a.store, dataDir); err != nil {
+			return err
+		}
+	}
+	if changed["CodeList.csv"] || changed["SubdivisionCodes.csv"] {
+		if err := a.clearBucket("Locodes"); err != nil {
+			return err
+		}
+		if err := loadLocodes(a.store, dataDir); err != nil {
+			return err
+		}
+	}
+
+	for _, bucket := range []string{"SpatialIndex", "Continents", "AirportsByIATA", "AirportsByCountry", "AirportsByName"} {
+		if err := a.clearBucket(bucket); err != nil {
+			return err
+		}
+	}
+
+	if err := resolveLocodes(a.store); err != nil {
+		return err
+	}
+	if err := buildSpatialIndex(a.store); err != nil {
+		return err
+	}
+	if err := loadContinents(a.store, dataDir); err != nil {
+		return err
+	}
+	if err := buildSecondaryIndexes(a.store); err != nil {
+		return err
+	}
+
+	return a.store.Update(func(tx Tx) error {
+		m, err := encodeBool(true)
+		if err != nil {
+			return err
+		}
+		return tx.Put([]byte("Meta"), []byte("IsPopulated"), m)
+	})
+}
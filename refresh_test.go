@@ -0,0 +1,162 @@
+package aptdata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const minimalContinentsGeoJSON = `{"type":"FeatureCollection","features":[]}`
+
+//writeAirportsCSV (re)writes a minimal airports.csv in dir with one row per
+//entry in rows, each a fully-populated record in ourairports.com's column
+//order.
+func writeAirportsCSV(t *testing.T, dir string, rows [][]string) {
+	t.Helper()
+
+	body := "id,ident,type,name,latitude_deg,longitude_deg,elevation_ft,continent,iso_country,iso_region,municipality,scheduled_service,gps_code,iata_code\n"
+	for _, row := range rows {
+		body += strings.Join(row, ",") + "\n"
+	}
+	if err := os.WriteFile(filepath.Join(dir, "airports.csv"), []byte(body), 0644); err != nil {
+		t.Fatalf("write airports.csv: %v", err)
+	}
+}
+
+//TestLoadChangedPurgesRemovedAirports checks that an incremental refresh
+//which sees airports.csv change actually removes airports that disappeared
+//from the file, rather than just upserting the ones still present, including
+//from the indexes that loadChanged rebuilds (buildSecondaryIndexes and
+//buildSpatialIndex). A memStore is enough since loadChanged only depends on
+//the Store interface.
+func TestLoadChangedPurgesRemovedAirports(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "continents.geojson"), []byte(minimalContinentsGeoJSON), 0644); err != nil {
+		t.Fatalf("write continents.geojson: %v", err)
+	}
+
+	writeAirportsCSV(t, dir, [][]string{
+		{"1", "KAAA", "large_airport", "Alpha Airport", "40.0", "-74.0", "10", "NA", "US", "US-NY", "New York", "yes", "KAAA", "AAA"},
+		{"2", "KBBB", "large_airport", "Bravo Airport", "41.0", "-75.0", "20", "NA", "US", "US-NY", "Buffalo", "yes", "KBBB", "BBB"},
+	})
+
+	store := NewMemStore()
+	a := NewAptDB(store)
+	if err := a.loadChanged(dir, map[string]bool{"airports.csv": true}); err != nil {
+		t.Fatalf("initial loadChanged: %v", err)
+	}
+
+	if _, err := a.GetAirportByIATA("BBB"); err != nil {
+		t.Fatalf("GetAirportByIATA(BBB) before removal: %v", err)
+	}
+
+	// Simulate KBBB disappearing from the next upstream airports.csv.
+	writeAirportsCSV(t, dir, [][]string{
+		{"1", "KAAA", "large_airport", "Alpha Airport", "40.0", "-74.0", "10", "NA", "US", "US-NY", "New York", "yes", "KAAA", "AAA"},
+	})
+
+	if err := a.loadChanged(dir, map[string]bool{"airports.csv": true}); err != nil {
+		t.Fatalf("second loadChanged: %v", err)
+	}
+
+	if _, err := a.GetAirport("KBBB"); err == nil {
+		t.Error("GetAirport(KBBB) still succeeds after KBBB was removed from airports.csv")
+	}
+	if _, err := a.GetAirportByIATA("BBB"); err == nil {
+		t.Error("GetAirportByIATA(BBB) still succeeds after KBBB was removed from airports.csv")
+	}
+
+	countryAirports, err := a.AirportsInCountry("US")
+	if err != nil {
+		t.Fatalf("AirportsInCountry: %v", err)
+	}
+	if len(countryAirports) != 1 {
+		t.Errorf("AirportsInCountry(US) returned %d airports after removal, want 1", len(countryAirports))
+	}
+
+	nearest, err := a.GetNearestAirports(40.5, -74.5, 10, Filter{})
+	if err != nil {
+		t.Fatalf("GetNearestAirports: %v", err)
+	}
+	for _, apt := range nearest {
+		if apt.Code == "KBBB" {
+			t.Error("GetNearestAirports still returned KBBB after it was removed from airports.csv")
+		}
+	}
+}
+
+//TestDownloadDataFileNotModified checks that downloadDataFile sends
+//conditional headers built from prior metadata and recognizes a 304
+//response as unchanged, reusing the prior DownloadMeta.
+func TestDownloadDataFileNotModified(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	spec := downloadFileSpec{file: "test.csv", url: srv.URL}
+
+	meta, notModified, err := downloadDataFile(context.Background(), dir, spec, DownloadMeta{}, RefreshOptions{})
+	if err != nil {
+		t.Fatalf("first download: %v", err)
+	}
+	if notModified {
+		t.Error("first download reported notModified with no prior ETag on record")
+	}
+	if meta.ETag != `"v1"` {
+		t.Errorf("ETag = %q, want %q", meta.ETag, `"v1"`)
+	}
+
+	meta2, notModified2, err := downloadDataFile(context.Background(), dir, spec, meta, RefreshOptions{})
+	if err != nil {
+		t.Fatalf("second download: %v", err)
+	}
+	if !notModified2 {
+		t.Error("second download with a matching ETag should report notModified")
+	}
+	if meta2 != meta {
+		t.Errorf("meta on a 304 response = %+v, want unchanged %+v", meta2, meta)
+	}
+}
+
+//TestDownloadDataFileSkipsOnChecksumMatch checks that downloadDataFile falls
+//back to a SHA-256 comparison when the server doesn't support conditional
+//requests but serves byte-identical content.
+func TestDownloadDataFileSkipsOnChecksumMatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("same-bytes"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	spec := downloadFileSpec{file: "test.csv", url: srv.URL}
+
+	meta, notModified, err := downloadDataFile(context.Background(), dir, spec, DownloadMeta{}, RefreshOptions{})
+	if err != nil {
+		t.Fatalf("first download: %v", err)
+	}
+	if notModified {
+		t.Error("first download should not be reported notModified")
+	}
+
+	meta2, notModified2, err := downloadDataFile(context.Background(), dir, spec, meta, RefreshOptions{})
+	if err != nil {
+		t.Fatalf("second download: %v", err)
+	}
+	if !notModified2 {
+		t.Error("second download with a matching body checksum should report notModified")
+	}
+	if meta2.SHA256 != meta.SHA256 {
+		t.Errorf("SHA256 changed across identical downloads: %q vs %q", meta.SHA256, meta2.SHA256)
+	}
+}
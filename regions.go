@@ -6,9 +6,7 @@ import (
 	"io"
 	"os"
 
-	"github.com/coreos/bbolt"
 	"github.com/pkg/errors"
-	"github.com/vmihailenco/msgpack"
 )
 
 //Region maps a region code to region name and local code
@@ -21,7 +19,7 @@ type Region struct {
 
 //loadRegions processes regions.csv and loads a Region struct into
 //the Regions bucket in the DB for every record
-func loadRegions(db *bolt.DB, dataDir string) error {
+func loadRegions(store Store, dataDir string) error {
 	regions, err := os.Open(fmt.Sprintf("%s/%s", dataDir, "regions.csv"))
 	if err != nil {
 		return err
@@ -31,13 +29,7 @@ func loadRegions(db *bolt.DB, dataDir string) error {
 	r := csv.NewReader(regions)
 	_, err = r.Read() // skip header
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucketIfNotExists([]byte("Regions"))
-		if err != nil {
-			return err
-		}
-		b := tx.Bucket([]byte("Regions"))
-
+	err = store.Update(func(tx Tx) error {
 		for {
 			record, err := r.Read()
 			if err == io.EOF {
@@ -52,12 +44,12 @@ func loadRegions(db *bolt.DB, dataDir string) error {
 				record[3],
 				record[5]}
 
-			m, err := msgpack.Marshal(&region)
+			m, err := encodeRegion(&region)
 			if err != nil {
 				return errors.Wrap(err, "region marshal")
 			}
 
-			err = b.Put([]byte(record[1]), m)
+			err = tx.Put([]byte("Regions"), []byte(record[1]), m)
 			if err != nil {
 				return errors.Wrap(err, "database put")
 			}
@@ -72,17 +64,19 @@ func loadRegions(db *bolt.DB, dataDir string) error {
 
 //GetRegion returns a Region struct representing the given code
 func (a *AptDB) GetRegion(ident string) (*Region, error) {
-	var region Region
-	err := a.boltDB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Regions"))
-		v := b.Get([]byte(ident))
-		err := msgpack.Unmarshal(v, &region)
+	var region *Region
+	err := a.store.View(func(tx Tx) error {
+		v, err := tx.Get([]byte("Regions"), []byte(ident))
+		if err != nil {
+			return err
+		}
+		region, err = decodeRegion(v)
 		return err
 	})
 
 	if err != nil {
-		return &region, errors.Wrap(err, "get region")
+		return region, errors.Wrap(err, "get region")
 	}
 
-	return &region, nil
+	return region, nil
 }
@@ -7,9 +7,7 @@ import (
 	"os"
 	"strconv"
 
-	"github.com/coreos/bbolt"
 	"github.com/pkg/errors"
-	"github.com/vmihailenco/msgpack"
 )
 
 //Runway represents the fundamental data for a runway.
@@ -37,7 +35,7 @@ type Runway struct {
 //loadRunways processes runways.csv and creates a Runway struct
 //representing each one which gets loaded into the Runways bucket in the
 //database.
-func loadRunways(db *bolt.DB, dataDir string) error {
+func loadRunways(store Store, dataDir string) error {
 	rwys, err := os.Open(fmt.Sprintf("%s/%s", dataDir, "runways.csv"))
 	if err != nil {
 		return err
@@ -48,21 +46,13 @@ func loadRunways(db *bolt.DB, dataDir string) error {
 	r.FieldsPerRecord = -1 // extra comma on first line
 	_, err = r.Read()      // skip header
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("Runways"))
-		if err != nil {
-			fmt.Println(err)
-			return err
-		}
-		//b := tx.Bucket([]byte("Runways"))
-
+	err = store.Update(func(tx Tx) error {
 		for {
 			record, err := r.Read()
 			if err == io.EOF {
 				break
 			}
 			if err != nil {
-				fmt.Println(err)
 				return errors.Wrap(err, "runway read")
 			}
 
@@ -100,16 +90,16 @@ func loadRunways(db *bolt.DB, dataDir string) error {
 				end2Heading,
 				end2Displaced}
 
-			m, err := msgpack.Marshal(&rwy)
+			m, err := encodeRunway(&rwy)
 			if err != nil {
 				return errors.Wrap(err, "runway marshal")
 			}
 
-			b2, err := b.CreateBucketIfNotExists([]byte(record[2]))
-			if err != nil {
+			bucket := []byte("Runways/" + record[2])
+			if err := tx.CreateNestedBucket(bucket); err != nil {
 				return errors.Wrap(err, "bucket creation")
 			}
-			err = b2.Put([]byte(record[8]+"/"+record[14]), m)
+			err = tx.Put(bucket, []byte(record[8]+"/"+record[14]), m)
 			if err != nil {
 				return errors.Wrap(err, "database put")
 			}
@@ -125,16 +115,15 @@ func loadRunways(db *bolt.DB, dataDir string) error {
 //GetRunways returns a slice of Runway structs for a given airport.
 func (a *AptDB) GetRunways(ident string) ([]*Runway, error) {
 	var runways []*Runway
-	err := a.boltDB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Runways"))
-		b2 := b.Bucket([]byte(ident))
-		b2.ForEach(func(k, v []byte) error {
-			var rwy Runway
-			msgpack.Unmarshal(v, &rwy)
-			runways = append(runways, &rwy)
+	err := a.store.View(func(tx Tx) error {
+		return tx.ForEachInBucket([]byte("Runways/"+ident), func(k, v []byte) error {
+			rwy, err := decodeRunway(v)
+			if err != nil {
+				return err
+			}
+			runways = append(runways, rwy)
 			return nil
 		})
-		return nil
 	})
 
 	if err != nil {
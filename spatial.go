@@ -0,0 +1,408 @@
+package aptdata
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+//earthRadiusKm is the mean radius of the earth in kilometers, used for
+//Haversine distance calculations.
+const earthRadiusKm = 6371.0
+
+//rtreeMaxEntries bounds the fan-out of each internal R-tree node.
+const rtreeMaxEntries = 8
+
+//rect is an axis-aligned bounding box in latitude/longitude space.
+type rect struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+//Filter restricts the results of a spatial search, consulting the Runways
+//bucket to exclude airports that don't meet the given criteria.
+type Filter struct {
+	LitOnly        bool
+	MinRunwayLenFt int64
+}
+
+//matches reports whether the airport identified by ident satisfies f,
+//consulting the Runways bucket within tx. A zero-value Filter matches
+//everything.
+func (f Filter) matches(tx Tx, ident string) bool {
+	if !f.LitOnly && f.MinRunwayLenFt == 0 {
+		return true
+	}
+
+	matched := false
+	tx.ForEachInBucket([]byte("Runways/"+ident), func(k, v []byte) error {
+		rwy, err := decodeRunway(v)
+		if err != nil {
+			return nil
+		}
+		if f.LitOnly && !rwy.Lighted {
+			return nil
+		}
+		if f.MinRunwayLenFt != 0 && rwy.Length < f.MinRunwayLenFt {
+			return nil
+		}
+		matched = true
+		return nil
+	})
+
+	return matched
+}
+
+//rtreeLeaf holds an airport's ICAO code and a point-degenerate bounding box.
+type rtreeLeaf struct {
+	Code string
+	Box  rect
+}
+
+//rtreeNode is either an internal node with child MBRs, or a leaf.
+type rtreeNode struct {
+	Box      rect
+	Children []rtreeNode
+	Leaf     *rtreeLeaf
+}
+
+//buildSpatialIndex reads every airport out of the Airports bucket and
+//builds a simple bottom-up R-tree over their coordinates, persisting the
+//result in the SpatialIndex bucket so subsequent opens don't need to
+//rebuild it.
+func buildSpatialIndex(store Store) error {
+	return store.Update(func(tx Tx) error {
+		var leaves []rtreeNode
+		err := tx.ForEachInBucket([]byte("Airports"), func(k, v []byte) error {
+			apt, err := decodeAirport(v)
+			if err != nil {
+				return err
+			}
+			leaves = append(leaves, rtreeNode{
+				Box:  rect{apt.Latitude, apt.Longitude, apt.Latitude, apt.Longitude},
+				Leaf: &rtreeLeaf{Code: apt.Code, Box: rect{apt.Latitude, apt.Longitude, apt.Latitude, apt.Longitude}},
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Sort leaves along a Hilbert space-filling curve before grouping
+		// them into parent nodes. ICAO code order (what ForEachInBucket
+		// yields) has no spatial correlation, so grouping in that order
+		// would leave every MBR spanning most of the globe; a Hilbert sort
+		// gives this bottom-up bulk-load the same locality an STR pack
+		// would, so best-first search actually prunes.
+		sort.Slice(leaves, func(i, j int) bool {
+			return hilbertD(leaves[i].Box.MinLat, leaves[i].Box.MinLon) < hilbertD(leaves[j].Box.MinLat, leaves[j].Box.MinLon)
+		})
+
+		root := buildRtreeLevel(leaves)
+
+		m, err := encodeRtreeNode(&root)
+		if err != nil {
+			return errors.Wrap(err, "spatial index marshal")
+		}
+
+		return tx.Put([]byte("SpatialIndex"), []byte("root"), m)
+	})
+}
+
+//buildRtreeLevel groups nodes into batches of rtreeMaxEntries and wraps each
+//batch in a parent node whose MBR covers all its children, repeating until
+//a single root node remains.
+func buildRtreeLevel(nodes []rtreeNode) rtreeNode {
+	if len(nodes) == 0 {
+		return rtreeNode{}
+	}
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+
+	var parents []rtreeNode
+	for i := 0; i < len(nodes); i += rtreeMaxEntries {
+		end := i + rtreeMaxEntries
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		group := nodes[i:end]
+
+		box := group[0].Box
+		for _, n := range group[1:] {
+			box = unionRect(box, n.Box)
+		}
+
+		parents = append(parents, rtreeNode{Box: box, Children: group})
+	}
+
+	return buildRtreeLevel(parents)
+}
+
+//hilbertGridSide is the side length (a power of two) of the grid that
+//lat/lon coordinates are quantized onto before computing their Hilbert
+//curve distance.
+const hilbertGridSide = 1 << 16
+
+//hilbertD maps (lat, lon) onto a point on a hilbertGridSide x hilbertGridSide
+//grid and returns its distance along the Hilbert curve, so that points
+//close in distance are close in space.
+func hilbertD(lat, lon float64) uint64 {
+	x := uint32((lon + 180) / 360 * (hilbertGridSide - 1))
+	y := uint32((lat + 90) / 180 * (hilbertGridSide - 1))
+
+	var d uint64
+	for s := uint32(hilbertGridSide) / 2; s > 0; s /= 2 {
+		var rx, ry uint32
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		d += uint64(s) * uint64(s) * uint64((3*rx)^ry)
+		x, y = hilbertRotate(s, x, y, rx, ry)
+	}
+
+	return d
+}
+
+//hilbertRotate applies the Hilbert curve's quadrant rotation/reflection
+//step to (x, y).
+func hilbertRotate(s, x, y, rx, ry uint32) (uint32, uint32) {
+	if ry != 0 {
+		return x, y
+	}
+	if rx == 1 {
+		x = s - 1 - x
+		y = s - 1 - y
+	}
+	return y, x
+}
+
+//unionRect returns the smallest rect covering both a and b.
+func unionRect(a, b rect) rect {
+	return rect{
+		MinLat: math.Min(a.MinLat, b.MinLat),
+		MinLon: math.Min(a.MinLon, b.MinLon),
+		MaxLat: math.Max(a.MaxLat, b.MaxLat),
+		MaxLon: math.Max(a.MaxLon, b.MaxLon),
+	}
+}
+
+//loadSpatialIndex reads the persisted R-tree root out of the SpatialIndex
+//bucket.
+func loadSpatialIndex(tx Tx) (*rtreeNode, error) {
+	v, err := tx.Get([]byte("SpatialIndex"), []byte("root"))
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, errors.New("spatial index not built")
+	}
+
+	return decodeRtreeNode(v)
+}
+
+//haversineKm returns the great-circle distance in kilometers between two
+//lat/lon points.
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return earthRadiusKm * c
+}
+
+//rectDistanceKm returns the Haversine distance from (lat, lon) to the
+//closest point on r's boundary, or zero if the point lies within r.
+func rectDistanceKm(lat, lon float64, r rect) float64 {
+	closestLat := math.Min(math.Max(lat, r.MinLat), r.MaxLat)
+	closestLon := math.Min(math.Max(lon, r.MinLon), r.MaxLon)
+	return haversineKm(lat, lon, closestLat, closestLon)
+}
+
+//searchItem is an entry in the best-first search priority queue.
+type searchItem struct {
+	node *rtreeNode
+	dist float64
+}
+
+//searchQueue is a min-heap of searchItem ordered by distance.
+type searchQueue []searchItem
+
+func (q searchQueue) Len() int            { return len(q) }
+func (q searchQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q searchQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *searchQueue) Push(x interface{}) { *q = append(*q, x.(searchItem)) }
+func (q *searchQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
+
+//GetNearestAirports returns the k airports nearest to (lat, lon) matching
+//filter, using a best-first search of the persisted R-tree ordered by
+//great-circle distance from the query point to each node's MBR.
+func (a *AptDB) GetNearestAirports(lat, lon float64, k int, filter Filter) ([]*Airport, error) {
+	var results []*Airport
+
+	err := a.store.View(func(tx Tx) error {
+		root, err := loadSpatialIndex(tx)
+		if err != nil {
+			return err
+		}
+
+		q := &searchQueue{{node: root, dist: rectDistanceKm(lat, lon, root.Box)}}
+		heap.Init(q)
+
+		for q.Len() > 0 && len(results) < k {
+			item := heap.Pop(q).(searchItem)
+			node := item.node
+
+			if node.Leaf != nil {
+				if !filter.matches(tx, node.Leaf.Code) {
+					continue
+				}
+				v, err := tx.Get([]byte("Airports"), []byte(node.Leaf.Code))
+				if err != nil {
+					return err
+				}
+				if v == nil {
+					continue
+				}
+				apt, err := decodeAirport(v)
+				if err != nil {
+					return errors.Wrap(err, "airport unmarshal")
+				}
+				results = append(results, apt)
+				continue
+			}
+
+			for i := range node.Children {
+				child := &node.Children[i]
+				heap.Push(q, searchItem{node: child, dist: rectDistanceKm(lat, lon, child.Box)})
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return results, errors.Wrap(err, "get nearest airports")
+	}
+
+	return results, nil
+}
+
+//GetAirportsInRadius returns every airport within km kilometers of
+//(lat, lon). It computes an equirectangular bounding box around the query
+//point, adjusting the longitude span by cos(lat) and clamping near the
+//poles, then descends the R-tree into any node whose MBR intersects that
+//box before filtering results by exact Haversine distance. If the bounding
+//box wraps the antimeridian, it is split into two sub-queries.
+func (a *AptDB) GetAirportsInRadius(lat, lon, km float64) ([]*Airport, error) {
+	var results []*Airport
+
+	latSpan := (km / earthRadiusKm) * (180 / math.Pi)
+	minLat := math.Max(lat-latSpan, -90)
+	maxLat := math.Min(lat+latSpan, 90)
+
+	cosLat := math.Cos(lat * math.Pi / 180)
+	var lonSpan float64
+	if cosLat < 0.01 {
+		lonSpan = 180
+	} else {
+		lonSpan = (km / earthRadiusKm) * (180 / math.Pi) / cosLat
+	}
+	minLon := lon - lonSpan
+	maxLon := lon + lonSpan
+
+	var boxes []rect
+	if minLon < -180 {
+		boxes = append(boxes,
+			rect{minLat, minLon + 360, maxLat, 180},
+			rect{minLat, -180, maxLat, maxLon})
+	} else if maxLon > 180 {
+		boxes = append(boxes,
+			rect{minLat, minLon, maxLat, 180},
+			rect{minLat, -180, maxLat, maxLon - 360})
+	} else {
+		boxes = append(boxes, rect{minLat, minLon, maxLat, maxLon})
+	}
+
+	err := a.store.View(func(tx Tx) error {
+		root, err := loadSpatialIndex(tx)
+		if err != nil {
+			return err
+		}
+
+		seen := make(map[string]bool)
+		for _, box := range boxes {
+			if err := collectInBox(tx, root, box, lat, lon, km, seen, &results); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return results, errors.Wrap(err, "get airports in radius")
+	}
+
+	return results, nil
+}
+
+//collectInBox descends node, recursing into any child whose MBR intersects
+//box, and appends any leaf airport within km of (lat, lon) to results.
+func collectInBox(tx Tx, node *rtreeNode, box rect, lat, lon, km float64, seen map[string]bool, results *[]*Airport) error {
+	if !intersects(node.Box, box) {
+		return nil
+	}
+
+	if node.Leaf != nil {
+		if seen[node.Leaf.Code] {
+			return nil
+		}
+		if haversineKm(lat, lon, node.Leaf.Box.MinLat, node.Leaf.Box.MinLon) > km {
+			return nil
+		}
+
+		v, err := tx.Get([]byte("Airports"), []byte(node.Leaf.Code))
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return nil
+		}
+		apt, err := decodeAirport(v)
+		if err != nil {
+			return errors.Wrap(err, "airport unmarshal")
+		}
+		seen[node.Leaf.Code] = true
+		*results = append(*results, apt)
+		return nil
+	}
+
+	for i := range node.Children {
+		if err := collectInBox(tx, &node.Children[i], box, lat, lon, km, seen, results); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//intersects reports whether two rects overlap.
+func intersects(a, b rect) bool {
+	return a.MinLat <= b.MaxLat && a.MaxLat >= b.MinLat &&
+		a.MinLon <= b.MaxLon && a.MaxLon >= b.MinLon
+}
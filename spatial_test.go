@@ -0,0 +1,113 @@
+package aptdata
+
+import "testing"
+
+//putTestAirport encodes and stores a minimal Airport record keyed by code.
+func putTestAirport(t *testing.T, store Store, code string, lat, lon float64) {
+	t.Helper()
+
+	apt := Airport{Code: code, Name: code, Latitude: lat, Longitude: lon, Country: "US"}
+	m, err := encodeAirport(&apt)
+	if err != nil {
+		t.Fatalf("encodeAirport(%s): %v", code, err)
+	}
+
+	err = store.Update(func(tx Tx) error {
+		return tx.Put([]byte("Airports"), []byte(code), m)
+	})
+	if err != nil {
+		t.Fatalf("put airport %s: %v", code, err)
+	}
+}
+
+//TestHilbertDLocality checks that the Hilbert curve distance used to order
+//R-tree leaves keeps spatially close points close together: two points a
+//few degrees apart should differ far less than two points on opposite
+//sides of the globe.
+func TestHilbertDLocality(t *testing.T) {
+	near1 := hilbertD(40.0, -74.0)
+	near2 := hilbertD(41.0, -75.0)
+
+	far := hilbertD(-33.0, 151.0)
+
+	nearDiff := near1 - near2
+	if near1 < near2 {
+		nearDiff = near2 - near1
+	}
+
+	farDiff := near1 - far
+	if near1 < far {
+		farDiff = far - near1
+	}
+
+	if nearDiff >= farDiff {
+		t.Errorf("hilbertD(near1)=%d, hilbertD(near2)=%d, hilbertD(far)=%d; expected nearby points to have a much smaller Hilbert distance gap than points on opposite sides of the globe", near1, near2, far)
+	}
+}
+
+//TestGetNearestAirports builds an R-tree over two widely separated clusters
+//and checks that a query near one cluster returns that cluster's airports,
+//closest first, without pulling in the distant cluster.
+func TestGetNearestAirports(t *testing.T) {
+	store := NewMemStore()
+
+	// Cluster around New York.
+	putTestAirport(t, store, "KNYC", 40.71, -74.00)
+	putTestAirport(t, store, "KNWK", 40.80, -74.10)
+	putTestAirport(t, store, "KNWJ", 40.90, -74.20)
+
+	// A lone airport on the other side of the world.
+	putTestAirport(t, store, "YSYD", -33.87, 151.21)
+
+	if err := buildSpatialIndex(store); err != nil {
+		t.Fatalf("buildSpatialIndex: %v", err)
+	}
+
+	a := NewAptDB(store)
+	results, err := a.GetNearestAirports(40.71, -74.00, 2, Filter{})
+	if err != nil {
+		t.Fatalf("GetNearestAirports: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("GetNearestAirports returned %d results, want 2", len(results))
+	}
+	if results[0].Code != "KNYC" {
+		t.Errorf("nearest airport = %s, want KNYC", results[0].Code)
+	}
+	for _, apt := range results {
+		if apt.Code == "YSYD" {
+			t.Error("GetNearestAirports(k=2) near New York returned the Sydney airport")
+		}
+	}
+}
+
+//TestGetAirportsInRadius checks that a radius search includes nearby
+//airports and excludes ones far outside the radius.
+func TestGetAirportsInRadius(t *testing.T) {
+	store := NewMemStore()
+
+	putTestAirport(t, store, "KNYC", 40.71, -74.00)
+	putTestAirport(t, store, "KNWK", 40.80, -74.10)
+	putTestAirport(t, store, "YSYD", -33.87, 151.21)
+
+	if err := buildSpatialIndex(store); err != nil {
+		t.Fatalf("buildSpatialIndex: %v", err)
+	}
+
+	a := NewAptDB(store)
+	results, err := a.GetAirportsInRadius(40.71, -74.00, 50)
+	if err != nil {
+		t.Fatalf("GetAirportsInRadius: %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, apt := range results {
+		found[apt.Code] = true
+	}
+	if !found["KNYC"] || !found["KNWK"] {
+		t.Errorf("GetAirportsInRadius(50km) = %v, want KNYC and KNWK", results)
+	}
+	if found["YSYD"] {
+		t.Error("GetAirportsInRadius(50km) near New York included the Sydney airport")
+	}
+}
@@ -0,0 +1,295 @@
+package aptdata
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/coreos/bbolt"
+)
+
+//bucketPathSep separates path components when a bucket argument addresses a
+//nested bucket, e.g. "Runways/KJFK".
+const bucketPathSep = "/"
+
+//Store abstracts the underlying persistence engine so AptDB is not hard-wired
+//to bbolt. Reads and writes happen inside a transaction closure passed to
+//View (read-only) or Update (read-write), mirroring bbolt's own transaction
+//model so existing callers translate directly.
+type Store interface {
+	View(fn func(tx Tx) error) error
+	Update(fn func(tx Tx) error) error
+	Close() error
+}
+
+//Tx represents a single storage transaction. A bucket argument names a
+//top-level bucket, or addresses a nested bucket via a "/"-separated path
+//(e.g. "Runways/KJFK").
+type Tx interface {
+	Get(bucket, key []byte) ([]byte, error)
+	Put(bucket, key, value []byte) error
+	ForEachInBucket(bucket []byte, fn func(k, v []byte) error) error
+	CreateNestedBucket(bucket []byte) error
+	DeleteBucket(bucket []byte) error
+	BucketExists(bucket []byte) bool
+}
+
+//splitBucketPath breaks a bucket argument into its path components.
+func splitBucketPath(bucket []byte) []string {
+	return strings.Split(string(bucket), bucketPathSep)
+}
+
+//boltStore is the Store implementation backed by a bbolt database file.
+type boltStore struct {
+	db *bolt.DB
+}
+
+//newBoltStore opens path as a bbolt database and wraps it as a Store.
+func newBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) View(fn func(tx Tx) error) error {
+	return s.db.View(func(btx *bolt.Tx) error {
+		return fn(&boltTx{tx: btx})
+	})
+}
+
+func (s *boltStore) Update(fn func(tx Tx) error) error {
+	return s.db.Update(func(btx *bolt.Tx) error {
+		return fn(&boltTx{tx: btx})
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+//boltTx is the Tx implementation backed by a *bolt.Tx, resolving "/"
+//separated bucket paths by walking nested bbolt buckets.
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+//openBucket walks path, creating buckets along the way if create is true.
+//It returns a nil bucket (with no error) if any path component is missing
+//and create is false.
+func (t *boltTx) openBucket(path []string, create bool) (*bolt.Bucket, error) {
+	var b *bolt.Bucket
+
+	for i, name := range path {
+		if i == 0 {
+			if create {
+				top, err := t.tx.CreateBucketIfNotExists([]byte(name))
+				if err != nil {
+					return nil, err
+				}
+				b = top
+			} else {
+				b = t.tx.Bucket([]byte(name))
+			}
+		} else {
+			if b == nil {
+				return nil, nil
+			}
+			if create {
+				child, err := b.CreateBucketIfNotExists([]byte(name))
+				if err != nil {
+					return nil, err
+				}
+				b = child
+			} else {
+				b = b.Bucket([]byte(name))
+			}
+		}
+
+		if b == nil {
+			return nil, nil
+		}
+	}
+
+	return b, nil
+}
+
+func (t *boltTx) Get(bucket, key []byte) ([]byte, error) {
+	b, err := t.openBucket(splitBucketPath(bucket), false)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return b.Get(key), nil
+}
+
+func (t *boltTx) Put(bucket, key, value []byte) error {
+	b, err := t.openBucket(splitBucketPath(bucket), true)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+func (t *boltTx) ForEachInBucket(bucket []byte, fn func(k, v []byte) error) error {
+	b, err := t.openBucket(splitBucketPath(bucket), false)
+	if err != nil || b == nil {
+		return err
+	}
+	return b.ForEach(fn)
+}
+
+func (t *boltTx) CreateNestedBucket(bucket []byte) error {
+	_, err := t.openBucket(splitBucketPath(bucket), true)
+	return err
+}
+
+func (t *boltTx) DeleteBucket(bucket []byte) error {
+	path := splitBucketPath(bucket)
+
+	var parent *bolt.Bucket
+	if len(path) > 1 {
+		var err error
+		parent, err = t.openBucket(path[:len(path)-1], false)
+		if err != nil || parent == nil {
+			return err
+		}
+	}
+
+	name := []byte(path[len(path)-1])
+	var err error
+	if parent == nil {
+		err = t.tx.DeleteBucket(name)
+	} else {
+		err = parent.DeleteBucket(name)
+	}
+	if err != nil && err.Error() == "bucket not found" {
+		return nil
+	}
+	return err
+}
+
+func (t *boltTx) BucketExists(bucket []byte) bool {
+	b, _ := t.openBucket(splitBucketPath(bucket), false)
+	return b != nil
+}
+
+//memStore is an in-memory Store implementation, useful for tests and for
+//read-only deployments that don't need a backing file.
+type memStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+//NewMemStore returns a Store that keeps all data in memory.
+func NewMemStore() Store {
+	return &memStore{buckets: make(map[string]map[string][]byte)}
+}
+
+func (s *memStore) View(fn func(tx Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(&memTx{buckets: s.buckets})
+}
+
+//Update runs fn against a working copy of the store's buckets, only
+//publishing that copy back to the store if fn returns nil. This gives
+//memStore the same all-or-nothing semantics as boltStore, whose underlying
+//bbolt transaction rolls back entirely on error.
+func (s *memStore) Update(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	working := copyBuckets(s.buckets)
+	if err := fn(&memTx{buckets: working}); err != nil {
+		return err
+	}
+
+	s.buckets = working
+	return nil
+}
+
+func (s *memStore) Close() error {
+	return nil
+}
+
+//copyBuckets returns a deep-enough copy of src for transactional use:
+//each bucket gets its own map, so writes during an Update can't be
+//observed until it commits, but stored values themselves are treated as
+//immutable and shared (Put always copies its input before storing it).
+func copyBuckets(src map[string]map[string][]byte) map[string]map[string][]byte {
+	dst := make(map[string]map[string][]byte, len(src))
+	for bucket, kv := range src {
+		newKV := make(map[string][]byte, len(kv))
+		for k, v := range kv {
+			newKV[k] = v
+		}
+		dst[bucket] = newKV
+	}
+	return dst
+}
+
+//memTx is the Tx implementation backed by a memStore's in-memory buckets.
+//A View transaction shares the store's live buckets; an Update transaction
+//operates on a private working copy that's only merged back on success.
+type memTx struct {
+	buckets map[string]map[string][]byte
+}
+
+func (t *memTx) Get(bucket, key []byte) ([]byte, error) {
+	b, ok := t.buckets[string(bucket)]
+	if !ok {
+		return nil, nil
+	}
+	return b[string(key)], nil
+}
+
+func (t *memTx) Put(bucket, key, value []byte) error {
+	b, ok := t.buckets[string(bucket)]
+	if !ok {
+		b = make(map[string][]byte)
+		t.buckets[string(bucket)] = b
+	}
+	cp := make([]byte, len(value))
+	copy(cp, value)
+	b[string(key)] = cp
+	return nil
+}
+
+func (t *memTx) ForEachInBucket(bucket []byte, fn func(k, v []byte) error) error {
+	b, ok := t.buckets[string(bucket)]
+	if !ok {
+		return nil
+	}
+	for k, v := range b {
+		if err := fn([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *memTx) CreateNestedBucket(bucket []byte) error {
+	if _, ok := t.buckets[string(bucket)]; !ok {
+		t.buckets[string(bucket)] = make(map[string][]byte)
+	}
+	return nil
+}
+
+func (t *memTx) DeleteBucket(bucket []byte) error {
+	prefix := string(bucket)
+	delete(t.buckets, prefix)
+
+	nestedPrefix := prefix + bucketPathSep
+	for k := range t.buckets {
+		if strings.HasPrefix(k, nestedPrefix) {
+			delete(t.buckets, k)
+		}
+	}
+
+	return nil
+}
+
+func (t *memTx) BucketExists(bucket []byte) bool {
+	_, ok := t.buckets[string(bucket)]
+	return ok
+}